@@ -0,0 +1,34 @@
+package imphash
+
+import (
+	"bytes"
+	"context"
+	"debug/macho"
+	"testing"
+)
+
+func TestFatImpHashPerArchKeysDisambiguateCollidingCpu(t *testing.T) {
+	raw := buildSyntheticFatMachO(macho.CpuArm, []uint32{1, 2})
+
+	result, err := fatImpHashFromReaderAt(context.Background(), bytes.NewReader(raw), Options{})
+	if err != nil {
+		t.Fatalf("fatImpHashFromReaderAt: %v", err)
+	}
+
+	if len(result.PerArch) != 2 {
+		t.Fatalf("expected 2 PerArch entries, got %d: %+v", len(result.PerArch), result.PerArch)
+	}
+	for _, key := range []string{"CpuArm_1", "CpuArm_2"} {
+		if _, ok := result.PerArch[key]; !ok {
+			t.Errorf("expected PerArch key %q, got keys %v", key, keysOf(result.PerArch))
+		}
+	}
+}
+
+func keysOf(m map[string]*ImpHashResult) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -2,16 +2,19 @@ package imphash
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"debug/elf"
 	"debug/macho"
 	"debug/pe"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"sort"
 	"strings"
 	"sync"
-	
+
 	"github.com/yalue/elf_reader"
 	"github.com/glaslos/ssdeep"
 )
@@ -20,23 +23,89 @@ type ImpHashResult struct {
 	ImpHash   string
 	ImpFuzzy  string
 	ImpString string
+	// TelfHash is only populated for ELF binaries; it holds the telfhash-style hash computed
+	// over the normalized dynamic symbol list, alongside the library-qualified ImpHash above.
+	TelfHash *ImpHashResult
+	// Imports is the sorted, deduplicated list backing ImpString, exposed as structured data so
+	// callers can build their own hashes or matching rules without reparsing ImpString.
+	Imports []ImportEntry
+}
+
+// ImportEntry is a single library/symbol pair contributing to an ImpHashResult. Ordinal is only
+// meaningful for PE imports resolved by ordinal; it is zero otherwise.
+type ImportEntry struct {
+	Library string
+	Symbol  string
+	Ordinal uint16
+}
+
+// Options bounds the work a single ImpHash computation will do. Zero means unlimited.
+type Options struct {
+	MaxSections int
+	MaxSymbols  int
+	// OrdinalTables supplements the built-in PE ordinal->name tables (keyed by lowercase DLL
+	// name without extension) for this call only.
+	OrdinalTables map[string]map[uint16]string
 }
 
+// ImpHashFromBytes detects the executable format of fileContents and computes its ImpHash.
 func ImpHashFromBytes(fileContents []byte) (*ImpHashResult, error) {
-	if bytes.HasPrefix(fileContents, []byte{0x4d, 0x5a}) {
-		return impHashFromPEBytes(fileContents)
+	return ImpHashFromReaderAt(bytes.NewReader(fileContents), int64(len(fileContents)))
+}
+
+// ImpHashFromBytesContext is ImpHashFromBytes with a context threaded through the parse, sort,
+// and ssdeep pipeline, and an Options to bound the work done on a single input.
+func ImpHashFromBytesContext(ctx context.Context, fileContents []byte, opts Options) (*ImpHashResult, error) {
+	return impHashFromReaderAt(ctx, bytes.NewReader(fileContents), int64(len(fileContents)), opts)
+}
+
+// ImpHashFromFile opens path and computes its ImpHash without reading the whole file into memory.
+func ImpHashFromFile(path string) (*ImpHashResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
-	if bytes.HasPrefix(fileContents, []byte{0x7f, 0x45, 0x4c, 0x46}) {
-		return impHashFromELFBytes(fileContents)
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
 	}
-	if bytes.HasPrefix(fileContents, []byte{0xfe, 0xed, 0xfa, 0xce}) || // 32-bit
-		bytes.HasPrefix(fileContents, []byte{0xce, 0xfa, 0xed, 0xfe}) || // 32-bit, reverse ordering
-		bytes.HasPrefix(fileContents, []byte{0xfe, 0xed, 0xfa, 0xcf}) || // 64-bit
-		bytes.HasPrefix(fileContents, []byte{0xcf, 0xfa, 0xed, 0xfe}) { // 64-bit, reverse ordering
-		return impHashFromMachO(fileContents)
+
+	return ImpHashFromReaderAt(f, fi.Size())
+}
+
+// ImpHashFromReaderAt detects the executable format behind r by inspecting its magic bytes and
+// computes the ImpHash, handing r directly to the relevant debug/* parser rather than buffering
+// the whole file up front.
+func ImpHashFromReaderAt(r io.ReaderAt, size int64) (*ImpHashResult, error) {
+	return impHashFromReaderAt(context.Background(), r, size, Options{})
+}
+
+func impHashFromReaderAt(ctx context.Context, r io.ReaderAt, size int64, opts Options) (*ImpHashResult, error) {
+	magicLen := int64(4)
+	if size < magicLen {
+		magicLen = size
+	}
+	magic := make([]byte, magicLen)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(magic, []byte{0x4d, 0x5a}) {
+		return impHashFromPE(ctx, r, opts)
+	}
+	if bytes.HasPrefix(magic, []byte{0x7f, 0x45, 0x4c, 0x46}) {
+		return impHashFromELF(ctx, r, size, opts)
 	}
-	if bytes.HasPrefix(fileContents, []byte{0xca, 0xfe, 0xba, 0xbe}) {
-		return impHashFromFatMachO(fileContents)
+	if bytes.HasPrefix(magic, []byte{0xfe, 0xed, 0xfa, 0xce}) || // 32-bit
+		bytes.HasPrefix(magic, []byte{0xce, 0xfa, 0xed, 0xfe}) || // 32-bit, reverse ordering
+		bytes.HasPrefix(magic, []byte{0xfe, 0xed, 0xfa, 0xcf}) || // 64-bit
+		bytes.HasPrefix(magic, []byte{0xcf, 0xfa, 0xed, 0xfe}) { // 64-bit, reverse ordering
+		return impHashFromMachO(ctx, r, opts)
+	}
+	if bytes.HasPrefix(magic, []byte{0xca, 0xfe, 0xba, 0xbe}) {
+		return impHashFromFatMachO(ctx, r, opts)
 	}
 	return nil, errors.New("File type not supported")
 }
@@ -47,30 +116,27 @@ var builderPool = sync.Pool{
 	},
 }
 
-func impHashFromPEBytes(fileContents []byte) (*ImpHashResult, error) {
-	fileReader := bytes.NewReader(fileContents)
-	pefile, err := pe.NewFile(fileReader)
+func impHashFromPE(ctx context.Context, r io.ReaderAt, opts Options) (*ImpHashResult, error) {
+	pefile, err := pe.NewFile(r)
 	if err != nil {
 		return nil, err
 	}
 
 	defer pefile.Close()
-	libs, err := pefile.ImportedSymbols()
+	libs, err := peImportedSymbols(pefile)
 	if err != nil {
 		return nil, err
 	}
+	if opts.MaxSymbols > 0 && len(libs) > opts.MaxSymbols {
+		libs = libs[:opts.MaxSymbols]
+	}
 
 	impHashes := &ImpHashResult{}
 
 	dllNames := make([]string, 0)
-	dllFunc := make(map[string][]string, 0)
+	dllFunc := make(map[string][]peFuncImport, 0)
 	for _, lib := range libs {
-		//fmt.Println(lib)
-		if !strings.Contains(lib, ":") {
-			continue
-		}
-		parts := strings.Split(lib, ":")
-		dllName := strings.ToLower(parts[1])
+		dllName := strings.ToLower(lib.Library)
 		if strings.HasSuffix(dllName, ".dll") {
 			dllName = strings.Replace(dllName, ".dll", "", 1)
 		} else {
@@ -78,8 +144,16 @@ func impHashFromPEBytes(fileContents []byte) (*ImpHashResult, error) {
 				dllName = strings.Replace(dllName, ".sys", "", 1)
 			}
 		}
-		funcName := strings.ToLower(parts[0])
-		dllFunc[dllName] = append(dllFunc[dllName], funcName)
+
+		var funcName string
+		var ordinal uint16
+		if lib.IsOrdinal {
+			ordinal = lib.Ordinal
+			funcName = resolveOrdinal(dllName, ordinal, opts.OrdinalTables)
+		} else {
+			funcName = strings.ToLower(lib.Symbol)
+		}
+		dllFunc[dllName] = append(dllFunc[dllName], peFuncImport{Name: funcName, Ordinal: ordinal})
 	}
 
 	for dllName := range dllFunc {
@@ -90,15 +164,17 @@ func impHashFromPEBytes(fileContents []byte) (*ImpHashResult, error) {
 	builder := builderPool.Get().(*strings.Builder)
 	builder.Reset()
 	for idx1, dllName := range dllNames {
-		sort.Strings(dllFunc[dllName])
-		for idx2, funcName := range dllFunc[dllName] {
+		funcs := dllFunc[dllName]
+		sort.Slice(funcs, func(i, j int) bool { return funcs[i].Name < funcs[j].Name })
+		for idx2, fn := range funcs {
 			if idx1+idx2 > 0 {
 				builder.WriteByte(',')
 			}
-			builder.Grow(len(dllName) + len(funcName) + 1)
+			builder.Grow(len(dllName) + len(fn.Name) + 1)
 			builder.WriteString(dllName)
 			builder.WriteString(".")
-			builder.WriteString(funcName)
+			builder.WriteString(fn.Name)
+			impHashes.Imports = append(impHashes.Imports, ImportEntry{Library: dllName, Symbol: fn.Name, Ordinal: fn.Ordinal})
 		}
 	}
 	impHashes.ImpHash = fmt.Sprintf("%x", md5.Sum([]byte(builder.String())))
@@ -110,6 +186,11 @@ func impHashFromPEBytes(fileContents []byte) (*ImpHashResult, error) {
 		}
 	}
 	impHashes.ImpString = builder.String()
+
+	if err := ctx.Err(); err != nil {
+		builderPool.Put(builder)
+		return nil, err
+	}
 	impHashes.ImpFuzzy, _ = ssdeep.FuzzyBytes([]byte(impHashes.ImpString))
 
 	builderPool.Put(builder)
@@ -117,51 +198,72 @@ func impHashFromPEBytes(fileContents []byte) (*ImpHashResult, error) {
 	return impHashes, nil
 }
 
-func sanityCheck(content []byte) error {
+// sanityCheck validates the section headers of the ELF image behind r (of the given size) before
+// debug/elf touches it, rejecting files that claim sections larger than the file itself or, when
+// opts.MaxSections is set, more sections than a legitimate binary should have. elf_reader.ParseELFFile
+// only takes a []byte, so this still fully buffers r into memory rather than streaming off the
+// io.ReaderAt like the PE and Mach-O paths do.
+func sanityCheck(ctx context.Context, r io.ReaderAt, size int64, opts Options) error {
+	content := make([]byte, size)
+	if _, err := r.ReadAt(content, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("reading ELF contents: %w", err)
+	}
+
 	e, err := elf_reader.ParseELFFile(content)
 	if err != nil {
 		return fmt.Errorf("parsing ELF: %w", err)
 	}
 
+	sectionCount := e.GetSectionCount()
+	if opts.MaxSections > 0 && int(sectionCount) > opts.MaxSections {
+		return fmt.Errorf("too many sections: %d > %d", sectionCount, opts.MaxSections)
+	}
+
 	var sum uint64
 
-	for i := uint16(0); i < e.GetSectionCount(); i++ {
+	for i := uint16(0); i < sectionCount; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		hdr, err := e.GetSectionHeader(i)
 		if err != nil {
 			return fmt.Errorf("getting header for section %d: %w", i, err)
 		}
 
-		if hdr.GetSize() > uint64(len(content)) {
-			return fmt.Errorf("section %d too large: %d > %d", i, hdr.GetSize(), len(content))
+		if hdr.GetSize() > uint64(size) {
+			return fmt.Errorf("section %d too large: %d > %d", i, hdr.GetSize(), size)
 		}
 
 		sum += hdr.GetSize()
-		if sum > uint64(len(content)) {
-			return fmt.Errorf("sections up to %d too large: %d > %d", i, sum, len(content))
+		if sum > uint64(size) {
+			return fmt.Errorf("sections up to %d too large: %d > %d", i, sum, size)
 		}
 	}
 
 	return nil
 }
 
-func impHashFromELFBytes(fileContents []byte) (*ImpHashResult, error) {
-	err := sanityCheck(fileContents)
+func impHashFromELF(ctx context.Context, r io.ReaderAt, size int64, opts Options) (*ImpHashResult, error) {
+	err := sanityCheck(ctx, r, size, opts)
 	if err != nil {
 		return nil, err
 	}
-		
-	fileReader := bytes.NewReader(fileContents)
-	e, err := elf.NewFile(fileReader)
+
+	e, err := elf.NewFile(r)
 	if err != nil {
 		return nil, err
 	}
 
 	defer e.Close()
-	
+
 	libs, err := e.ImportedSymbols()
 	if err != nil {
 		return nil, err
 	}
+	if opts.MaxSymbols > 0 && len(libs) > opts.MaxSymbols {
+		libs = libs[:opts.MaxSymbols]
+	}
 
 	libFunc := make(map[string][]string, 0)
 	for _, lib := range libs {
@@ -179,6 +281,7 @@ func impHashFromELFBytes(fileContents []byte) (*ImpHashResult, error) {
 	}
 	sort.Strings(libNames)
 	builder := strings.Builder{}
+	impHashes := &ImpHashResult{}
 	for idx1, dllName := range libNames {
 		sort.Strings(libFunc[dllName])
 		for idx2, funcName := range libFunc[dllName] {
@@ -189,10 +292,10 @@ func impHashFromELFBytes(fileContents []byte) (*ImpHashResult, error) {
 			builder.WriteString(dllName)
 			builder.WriteString(".")
 			builder.WriteString(funcName)
+			impHashes.Imports = append(impHashes.Imports, ImportEntry{Library: dllName, Symbol: funcName})
 		}
 	}
 
-	impHashes := &ImpHashResult{}
 	impHashes.ImpHash = fmt.Sprintf("%x", md5.Sum([]byte(builder.String())))
 
 	for {
@@ -203,26 +306,29 @@ func impHashFromELFBytes(fileContents []byte) (*ImpHashResult, error) {
 		}
 	}
 	impHashes.ImpString = builder.String()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	impHashes.ImpFuzzy, _ = ssdeep.FuzzyBytes([]byte(impHashes.ImpString))
 
-	builderPool.Put(builder)
+	impHashes.TelfHash, err = telfHashFromELFFile(e)
+	if err != nil {
+		return nil, err
+	}
 
 	return impHashes, nil
 }
 
-func impHashFromMachO(fileContents []byte) (*ImpHashResult, error) {
-	fileReader := bytes.NewReader(fileContents)
-	m, err := macho.NewFile(fileReader)
-	if err != nil {
-		return nil, err
-	}
+// machOImportSet collects the de-duplicated set of imported library and symbol names for a
+// single Mach-O image, mirroring the union pefile/impHashFromMachO have always hashed over.
+func machOImportSet(m *macho.File, opts Options) (map[string]int, error) {
+	libFunc := make(map[string]int, 0)
 
 	libs, err := m.ImportedLibraries()
 	if err != nil {
 		return nil, err
 	}
-
-	libFunc := make(map[string]int, 0)
 	for _, lib := range libs {
 		libname := lib
 		soIdx := strings.Index(libname, ".dylib")
@@ -236,27 +342,37 @@ func impHashFromMachO(fileContents []byte) (*ImpHashResult, error) {
 	if err != nil {
 		return nil, err
 	}
+	if opts.MaxSymbols > 0 && len(symbols) > opts.MaxSymbols {
+		symbols = symbols[:opts.MaxSymbols]
+	}
 	for _, symb := range symbols {
 		libFunc[symb] = 1
 	}
 
-	libNames := make([]string, 0)
-	for lib := range libFunc {
-		libNames = append(libNames, lib)
+	return libFunc, nil
+}
+
+// impHashFromNameSet sorts names, joins them the same way as the other impHashFrom* functions,
+// and hashes the result.
+func impHashFromNameSet(ctx context.Context, names map[string]int) (*ImpHashResult, error) {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
 	}
-	sort.Strings(libNames)
+	sort.Strings(sorted)
 
 	builder := builderPool.Get().(*strings.Builder)
 	builder.Reset()
-	for idx, dllName := range libNames {
+	impHashes := &ImpHashResult{}
+	for idx, name := range sorted {
 		if idx > 0 {
 			builder.WriteByte(',')
 		}
-		builder.Grow(len(dllName) + 1)
-		builder.WriteString(dllName)
+		builder.Grow(len(name) + 1)
+		builder.WriteString(name)
+		impHashes.Imports = append(impHashes.Imports, ImportEntry{Symbol: name})
 	}
 
-	impHashes := &ImpHashResult{}
 	impHashes.ImpHash = fmt.Sprintf("%x", md5.Sum([]byte(builder.String())))
 	for {
 		if builder.Len() < 4096 {
@@ -266,6 +382,11 @@ func impHashFromMachO(fileContents []byte) (*ImpHashResult, error) {
 		}
 	}
 	impHashes.ImpString = builder.String()
+
+	if err := ctx.Err(); err != nil {
+		builderPool.Put(builder)
+		return nil, err
+	}
 	impHashes.ImpFuzzy, _ = ssdeep.FuzzyBytes([]byte(impHashes.ImpString))
 
 	builderPool.Put(builder)
@@ -273,67 +394,79 @@ func impHashFromMachO(fileContents []byte) (*ImpHashResult, error) {
 	return impHashes, nil
 }
 
-func impHashFromFatMachO(fileContents []byte) (*ImpHashResult, error) {
-	fileReader := bytes.NewReader(fileContents)
-	m, err := macho.NewFatFile(fileReader)
+func impHashFromMachOFile(ctx context.Context, m *macho.File, opts Options) (*ImpHashResult, error) {
+	libFunc, err := machOImportSet(m, opts)
+	if err != nil {
+		return nil, err
+	}
+	return impHashFromNameSet(ctx, libFunc)
+}
+
+func impHashFromMachO(ctx context.Context, r io.ReaderAt, opts Options) (*ImpHashResult, error) {
+	m, err := macho.NewFile(r)
 	if err != nil {
 		return nil, err
 	}
+	return impHashFromMachOFile(ctx, m, opts)
+}
+
+// FatImpHashResult carries both a per-architecture breakdown and the legacy cross-slice union
+// for a fat (universal) Mach-O binary.
+type FatImpHashResult struct {
+	PerArch  map[string]*ImpHashResult
+	Combined *ImpHashResult
+}
+
+// FatImpHashFromBytes computes an ImpHash for every architecture slice in a fat Mach-O binary,
+// keyed by Cpu.String(), alongside the Combined union hash that ImpHashFromBytes returns.
+func FatImpHashFromBytes(fileContents []byte) (*FatImpHashResult, error) {
+	return fatImpHashFromReaderAt(context.Background(), bytes.NewReader(fileContents), Options{})
+}
 
-	libFunc := make(map[string]int, 0) // Using it as a set
+func fatImpHashFromReaderAt(ctx context.Context, r io.ReaderAt, opts Options) (*FatImpHashResult, error) {
+	m, err := macho.NewFatFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cpuCount := make(map[string]int, len(m.Arches))
+	for _, arch := range m.Arches {
+		cpuCount[arch.Cpu.String()]++
+	}
+
+	result := &FatImpHashResult{PerArch: make(map[string]*ImpHashResult, len(m.Arches))}
+	combined := make(map[string]int, 0)
 	for _, arch := range m.Arches {
-		libs, err := arch.ImportedLibraries()
+		libFunc, err := machOImportSet(arch.File, opts)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, lib := range libs {
-			libname := lib
-			soIdx := strings.Index(libname, ".dylib")
-			if soIdx > 0 {
-				libname = libname[:soIdx]
-			}
-			libFunc[libname] = 1
+		key := arch.Cpu.String()
+		if cpuCount[key] > 1 {
+			key = fmt.Sprintf("%s_%d", key, arch.SubCpu)
 		}
-
-		symbols, err := arch.ImportedSymbols()
+		result.PerArch[key], err = impHashFromNameSet(ctx, libFunc)
 		if err != nil {
 			return nil, err
 		}
-		for _, symb := range symbols {
-			libFunc[symb] = 1
-		}
-	}
-
-	libNames := make([]string, 0)
-	for lib := range libFunc {
-		libNames = append(libNames, lib)
-	}
 
-	sort.Strings(libNames)
-	builder := builderPool.Get().(*strings.Builder)
-	builder.Reset()
-	for idx, dllName := range libNames {
-		if idx > 0 {
-			builder.WriteByte(',')
+		for name := range libFunc {
+			combined[name] = 1
 		}
-		builder.Grow(len(dllName) + 1)
-		builder.WriteString(dllName)
 	}
-
-	impHashes := &ImpHashResult{}
-	impHashes.ImpHash = fmt.Sprintf("%x", md5.Sum([]byte(builder.String())))
-	for {
-		if builder.Len() < 4096 {
-			builder.WriteString(" ")
-		} else {
-			break
-		}
+	result.Combined, err = impHashFromNameSet(ctx, combined)
+	if err != nil {
+		return nil, err
 	}
-	impHashes.ImpString = builder.String()
-	impHashes.ImpFuzzy, _ = ssdeep.FuzzyBytes([]byte(impHashes.ImpString))
 
-	builderPool.Put(builder)
+	return result, nil
+}
 
-	return impHashes, nil
+func impHashFromFatMachO(ctx context.Context, r io.ReaderAt, opts Options) (*ImpHashResult, error) {
+	fat, err := fatImpHashFromReaderAt(ctx, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return fat.Combined, nil
 }
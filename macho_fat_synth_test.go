@@ -0,0 +1,72 @@
+package imphash
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+)
+
+// buildThinMachO assembles a minimal valid 32-bit Mach-O slice for cpu/subCpu, carrying empty
+// LC_SYMTAB/LC_DYSYMTAB load commands so debug/macho's ImportedSymbols doesn't error out on a
+// missing symbol table, but no actual imports.
+func buildThinMachO(cpu macho.Cpu, subCpu uint32) []byte {
+	symtab := macho.SymtabCmd{Cmd: macho.LoadCmdSymtab, Len: 24}
+	dysymtab := macho.DysymtabCmd{Cmd: macho.LoadCmdDysymtab, Len: 80}
+
+	var cmds bytes.Buffer
+	binary.Write(&cmds, binary.LittleEndian, symtab)
+	binary.Write(&cmds, binary.LittleEndian, dysymtab)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{
+		Magic:  macho.Magic32,
+		Cpu:    cpu,
+		SubCpu: subCpu,
+		Type:   macho.TypeExec,
+		Ncmd:   2,
+		Cmdsz:  uint32(cmds.Len()),
+		Flags:  0,
+	})
+	buf.Write(cmds.Bytes())
+	return buf.Bytes()
+}
+
+// buildSyntheticFatMachO assembles a fat Mach-O whose slices share a Cpu but have distinct
+// SubCpu values, the case fatImpHashFromReaderAt must disambiguate in its PerArch keys.
+func buildSyntheticFatMachO(cpu macho.Cpu, subCpus []uint32) []byte {
+	slices := make([][]byte, len(subCpus))
+	for i, sc := range subCpus {
+		slices[i] = buildThinMachO(cpu, sc)
+	}
+
+	const headerSize = 8 // magic + narch
+	const archHeaderSize = 20
+	offset := uint32(headerSize + archHeaderSize*len(slices))
+	offsets := make([]uint32, len(slices))
+	for i, s := range slices {
+		offsets[i] = offset
+		offset += uint32(len(s))
+		for offset%4 != 0 {
+			offset++
+		}
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, macho.MagicFat)
+	binary.Write(&buf, binary.BigEndian, uint32(len(slices)))
+	for i, sc := range subCpus {
+		binary.Write(&buf, binary.BigEndian, macho.FatArchHeader{
+			Cpu:    cpu,
+			SubCpu: sc,
+			Offset: offsets[i],
+			Size:   uint32(len(slices[i])),
+			Align:  2,
+		})
+	}
+	for i, s := range slices {
+		buf.Write(make([]byte, int(offsets[i])-buf.Len()))
+		buf.Write(s)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,46 @@
+package imphash
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestImpHashFromBytesContextCancelled(t *testing.T) {
+	const path = "/bin/ls"
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Skipf("no %s on this system: %v", path, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ImpHashFromBytesContext(ctx, raw, Options{}); err != context.Canceled {
+		t.Fatalf("ImpHashFromBytesContext with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestImpHashFromBytesContextMaxSymbolsTruncates(t *testing.T) {
+	const path = "/bin/ls"
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Skipf("no %s on this system: %v", path, err)
+	}
+
+	full, err := ImpHashFromBytesContext(context.Background(), raw, Options{})
+	if err != nil {
+		t.Fatalf("ImpHashFromBytesContext: %v", err)
+	}
+	if len(full.Imports) < 2 {
+		t.Skipf("%s only has %d imports, too few to exercise truncation", path, len(full.Imports))
+	}
+
+	truncated, err := ImpHashFromBytesContext(context.Background(), raw, Options{MaxSymbols: 1})
+	if err != nil {
+		t.Fatalf("ImpHashFromBytesContext with MaxSymbols: %v", err)
+	}
+	if len(truncated.Imports) != 1 {
+		t.Fatalf("len(Imports) = %d, want 1 with MaxSymbols: 1", len(truncated.Imports))
+	}
+}
@@ -0,0 +1,89 @@
+package imphash
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ordinalTables maps a DLL name (lowercase, no extension) to its known ordinal->symbol table.
+// These are the handful of system DLLs where tools routinely import by ordinal instead of by
+// name (winsock's BSD-socket-era exports being the canonical example), mirroring the table
+// pefile ships so hashes computed here line up with it. It is read-only after init: callers
+// extend resolution per call via Options.OrdinalTables instead of mutating shared state, so a
+// hash stays a pure function of its input bytes and the Options passed alongside them.
+var ordinalTables = map[string]map[uint16]string{
+	"ws2_32":  winsockOrdinals,
+	"wsock32": winsockOrdinals,
+	"oleaut32": {
+		2:   "sysallocstring",
+		4:   "sysreallocstring",
+		6:   "sysfreestring",
+		8:   "sysstringlen",
+		150: "variantinit",
+		158: "variantclear",
+		172: "varbstrcat",
+	},
+	"comctl32": {
+		6:  "initcommoncontrols",
+		13: "imagelist_create",
+		17: "createtoolbarex",
+	},
+}
+
+var winsockOrdinals = map[uint16]string{
+	1:   "accept",
+	2:   "bind",
+	3:   "closesocket",
+	4:   "connect",
+	5:   "getpeername",
+	6:   "getsockname",
+	7:   "getsockopt",
+	8:   "htonl",
+	9:   "htons",
+	10:  "ioctlsocket",
+	11:  "inet_addr",
+	12:  "inet_ntoa",
+	13:  "listen",
+	14:  "ntohl",
+	15:  "ntohs",
+	16:  "recv",
+	17:  "recvfrom",
+	18:  "select",
+	19:  "send",
+	20:  "sendto",
+	21:  "setsockopt",
+	22:  "shutdown",
+	23:  "socket",
+	52:  "gethostbyaddr",
+	53:  "gethostbyname",
+	54:  "getprotobyname",
+	55:  "getprotobynumber",
+	56:  "getservbyname",
+	57:  "getservbyport",
+	58:  "gethostname",
+	111: "wsagetlasterror",
+	112: "wsasetlasterror",
+	115: "wsastartup",
+	116: "wsacleanup",
+	151: "wsafdisset",
+}
+
+// resolveOrdinal returns the canonical lowercase symbol name for an ordinal-only import of dll,
+// checking extra (from Options.OrdinalTables, taking precedence) before the built-in table, and
+// falling back to "ord<num>" so the symbol still participates in the hash when the ordinal is
+// unknown.
+func resolveOrdinal(dll string, ordinal uint16, extra map[string]map[uint16]string) string {
+	dll = strings.ToLower(dll)
+
+	if table, ok := extra[dll]; ok {
+		if name, ok := table[ordinal]; ok {
+			return name
+		}
+	}
+	if table, ok := ordinalTables[dll]; ok {
+		if name, ok := table[ordinal]; ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("ord%d", ordinal)
+}
@@ -0,0 +1,143 @@
+package imphash
+
+import (
+	"debug/pe"
+	"encoding/binary"
+)
+
+// peImport is a single entry from the PE import directory, named either by symbol or, for
+// imports that only carry an ordinal, by Ordinal. pe.File.ImportedSymbols (see debug/pe) drops
+// ordinal-only imports entirely ("TODO add dynimport ordinal support"), so peImportedSymbols
+// re-walks the same import directory itself to keep them.
+type peImport struct {
+	Library   string
+	Symbol    string
+	Ordinal   uint16
+	IsOrdinal bool
+}
+
+// peFuncImport is a single resolved (library already split off) import entry queued up for
+// sorting and hashing in impHashFromPE.
+type peFuncImport struct {
+	Name    string
+	Ordinal uint16
+}
+
+// peImportedSymbols walks f's import directory the same way pe.File.ImportedSymbols does, but
+// keeps ordinal-only thunks instead of discarding them.
+func peImportedSymbols(f *pe.File) ([]peImport, error) {
+	if f.OptionalHeader == nil {
+		return nil, nil
+	}
+
+	oh64, pe64 := f.OptionalHeader.(*pe.OptionalHeader64)
+	oh32, _ := f.OptionalHeader.(*pe.OptionalHeader32)
+
+	var ddLength uint32
+	var dataDirectory [16]pe.DataDirectory
+	if pe64 {
+		ddLength = oh64.NumberOfRvaAndSizes
+		dataDirectory = oh64.DataDirectory
+	} else {
+		ddLength = oh32.NumberOfRvaAndSizes
+		dataDirectory = oh32.DataDirectory
+	}
+
+	if ddLength < pe.IMAGE_DIRECTORY_ENTRY_IMPORT+1 {
+		return nil, nil
+	}
+	idd := dataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT]
+
+	var ds *pe.Section
+	for _, s := range f.Sections {
+		if s.Offset == 0 {
+			continue
+		}
+		if s.VirtualAddress <= idd.VirtualAddress && idd.VirtualAddress-s.VirtualAddress < s.VirtualSize {
+			ds = s
+			break
+		}
+	}
+	if ds == nil {
+		return nil, nil
+	}
+
+	d, err := ds.Data()
+	if err != nil {
+		return nil, err
+	}
+	d = d[idd.VirtualAddress-ds.VirtualAddress:]
+
+	type importDirectoryEntry struct {
+		originalFirstThunk uint32
+		name               uint32
+	}
+
+	var dirs []importDirectoryEntry
+	for len(d) >= 20 {
+		var dt importDirectoryEntry
+		dt.originalFirstThunk = binary.LittleEndian.Uint32(d[0:4])
+		dt.name = binary.LittleEndian.Uint32(d[12:16])
+		d = d[20:]
+		if dt.originalFirstThunk == 0 {
+			break
+		}
+		dirs = append(dirs, dt)
+	}
+
+	names, _ := ds.Data()
+	var all []peImport
+	for _, dt := range dirs {
+		dll, _ := peGetString(names, int(dt.name-ds.VirtualAddress))
+
+		thunk, _ := ds.Data()
+		thunk = thunk[dt.originalFirstThunk-ds.VirtualAddress:]
+		for {
+			if pe64 {
+				if len(thunk) < 8 {
+					break
+				}
+				va := binary.LittleEndian.Uint64(thunk[0:8])
+				thunk = thunk[8:]
+				if va == 0 {
+					break
+				}
+				if va&0x8000000000000000 > 0 {
+					all = append(all, peImport{Library: dll, Ordinal: uint16(va & 0xffff), IsOrdinal: true})
+					continue
+				}
+				fn, _ := peGetString(names, int(uint32(va)-ds.VirtualAddress+2))
+				all = append(all, peImport{Library: dll, Symbol: fn})
+			} else {
+				if len(thunk) < 4 {
+					break
+				}
+				va := binary.LittleEndian.Uint32(thunk[0:4])
+				thunk = thunk[4:]
+				if va == 0 {
+					break
+				}
+				if va&0x80000000 > 0 {
+					all = append(all, peImport{Library: dll, Ordinal: uint16(va & 0xffff), IsOrdinal: true})
+					continue
+				}
+				fn, _ := peGetString(names, int(va-ds.VirtualAddress+2))
+				all = append(all, peImport{Library: dll, Symbol: fn})
+			}
+		}
+	}
+
+	return all, nil
+}
+
+func peGetString(section []byte, start int) (string, bool) {
+	if start < 0 || start >= len(section) {
+		return "", false
+	}
+	for end := start; end < len(section); end++ {
+		if section[end] == 0 {
+			return string(section[start:end]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,74 @@
+package imphash
+
+import (
+	"bytes"
+	"debug/pe"
+	"strings"
+	"testing"
+)
+
+func TestPeImportedSymbolsOrdinalOnly(t *testing.T) {
+	raw := buildSyntheticOrdinalPE("ws2_32.dll", 1)
+
+	f, err := pe.NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("pe.NewFile: %v", err)
+	}
+	defer f.Close()
+
+	if stdlib, err := f.ImportedSymbols(); err != nil {
+		t.Fatalf("stdlib ImportedSymbols: %v", err)
+	} else if len(stdlib) != 0 {
+		t.Fatalf("expected stdlib ImportedSymbols to drop the ordinal-only import, got %v", stdlib)
+	}
+
+	imports, err := peImportedSymbols(f)
+	if err != nil {
+		t.Fatalf("peImportedSymbols: %v", err)
+	}
+	if len(imports) != 1 {
+		t.Fatalf("expected 1 import, got %d: %+v", len(imports), imports)
+	}
+
+	imp := imports[0]
+	if !imp.IsOrdinal {
+		t.Fatalf("expected an ordinal-only import, got %+v", imp)
+	}
+	if imp.Library != "ws2_32.dll" {
+		t.Fatalf("Library = %q, want ws2_32.dll", imp.Library)
+	}
+	if imp.Ordinal != 1 {
+		t.Fatalf("Ordinal = %d, want 1", imp.Ordinal)
+	}
+
+	if got, want := resolveOrdinal("ws2_32", imp.Ordinal, nil), "accept"; got != want {
+		t.Fatalf("resolveOrdinal(%q, %d) = %q, want %q", "ws2_32", imp.Ordinal, got, want)
+	}
+}
+
+func TestImpHashFromBytesOrdinalOnlyImport(t *testing.T) {
+	raw := buildSyntheticOrdinalPE("ws2_32.dll", 1)
+
+	result, err := ImpHashFromBytes(raw)
+	if err != nil {
+		t.Fatalf("ImpHashFromBytes: %v", err)
+	}
+
+	if len(result.Imports) != 1 {
+		t.Fatalf("expected 1 import, got %d: %+v", len(result.Imports), result.Imports)
+	}
+
+	imp := result.Imports[0]
+	if imp.Library != "ws2_32" {
+		t.Fatalf("Library = %q, want ws2_32", imp.Library)
+	}
+	if imp.Symbol != "accept" {
+		t.Fatalf("Symbol = %q, want accept (resolved from ordinal 1)", imp.Symbol)
+	}
+	if imp.Ordinal != 1 {
+		t.Fatalf("Ordinal = %d, want 1", imp.Ordinal)
+	}
+	if got := strings.TrimRight(result.ImpString, " "); got != "ws2_32.accept" {
+		t.Fatalf("ImpString = %q, want ws2_32.accept (padding aside)", got)
+	}
+}
@@ -0,0 +1,73 @@
+package imphash
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+)
+
+// buildSyntheticOrdinalPE assembles a minimal but valid 32-bit PE image with a single
+// import descriptor for dllName, whose only thunk is an ordinal-only import (no name
+// entry at all), the case debug/pe.File.ImportedSymbols silently drops.
+func buildSyntheticOrdinalPE(dllName string, ordinal uint16) []byte {
+	const (
+		sectionRVA = 0x200
+		fileAlign  = 0x200
+	)
+
+	dirRVA := uint32(sectionRVA)
+	intRVA := dirRVA + 40 // two 20-byte descriptors (one entry + terminator)
+	nameRVA := intRVA + 8 // one 4-byte ordinal thunk + 4-byte terminator
+
+	section := make([]byte, fileAlign)
+	// Import descriptor for dllName.
+	binary.LittleEndian.PutUint32(section[0:4], intRVA)    // OriginalFirstThunk
+	binary.LittleEndian.PutUint32(section[12:16], nameRVA) // Name
+	binary.LittleEndian.PutUint32(section[16:20], intRVA)  // FirstThunk
+	// Descriptor terminator at section[20:40] stays zero.
+	// INT: a single ordinal-flagged thunk, then a zero terminator.
+	binary.LittleEndian.PutUint32(section[40:44], 0x80000000|uint32(ordinal))
+	copy(section[48:], dllName)
+	section[48+len(dllName)] = 0
+
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	dos[0] = 'M'
+	dos[1] = 'Z'
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+
+	binary.Write(&buf, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_I386,
+		NumberOfSections:     1,
+		SizeOfOptionalHeader: 0xe0,
+		Characteristics:      0x0102,
+	})
+
+	oh := pe.OptionalHeader32{
+		Magic:               0x10b,
+		ImageBase:           0x400000,
+		SectionAlignment:    fileAlign,
+		FileAlignment:       fileAlign,
+		SizeOfImage:         sectionRVA + fileAlign,
+		SizeOfHeaders:       fileAlign,
+		NumberOfRvaAndSizes: 16,
+	}
+	oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT] = pe.DataDirectory{VirtualAddress: dirRVA, Size: 40}
+	binary.Write(&buf, binary.LittleEndian, oh)
+
+	var sh pe.SectionHeader32
+	copy(sh.Name[:], ".idata")
+	sh.VirtualSize = fileAlign
+	sh.VirtualAddress = sectionRVA
+	sh.SizeOfRawData = fileAlign
+	sh.PointerToRawData = sectionRVA
+	sh.Characteristics = 0xc0000040
+	binary.Write(&buf, binary.LittleEndian, sh)
+
+	buf.Write(make([]byte, fileAlign-buf.Len()))
+	buf.Write(section)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,110 @@
+package imphash
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"debug/elf"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/glaslos/ssdeep"
+)
+
+// telfhashIgnoredPrefixes are libc/loader symbol prefixes that telfhash excludes because they
+// show up in virtually every ELF binary and carry no discriminating signal.
+var telfhashIgnoredPrefixes = []string{
+	"__libc_",
+	"__cxa_",
+}
+
+var telfhashIgnoredNames = map[string]bool{
+	"_init":  true,
+	"_fini":  true,
+	"_start": true,
+}
+
+// TelfHashFromBytes computes a telfhash-style ELF import hash: the normalized, deduplicated,
+// sorted list of imported dynamic symbols, ssdeep-fuzzed and MD5-hashed over the joined string.
+func TelfHashFromBytes(fileContents []byte) (*ImpHashResult, error) {
+	return TelfHashFromReaderAt(bytes.NewReader(fileContents), int64(len(fileContents)))
+}
+
+// TelfHashFromReaderAt is the io.ReaderAt counterpart of TelfHashFromBytes.
+func TelfHashFromReaderAt(r io.ReaderAt, size int64) (*ImpHashResult, error) {
+	if err := sanityCheck(context.Background(), r, size, Options{}); err != nil {
+		return nil, err
+	}
+
+	e, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+
+	return telfHashFromELFFile(e)
+}
+
+func telfHashFromELFFile(e *elf.File) (*ImpHashResult, error) {
+	symbols, err := e.DynamicSymbols()
+	if err != nil {
+		if err == elf.ErrNoSymbols {
+			return &ImpHashResult{}, nil
+		}
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(symbols))
+	for _, sym := range symbols {
+		if sym.Name == "" || elf.ST_BIND(sym.Info) == elf.STB_WEAK {
+			continue
+		}
+
+		name := sym.Name
+		if at := strings.IndexByte(name, '@'); at >= 0 {
+			name = name[:at]
+		}
+		name = strings.ToLower(name)
+
+		if telfhashIgnoredNames[name] || telfhashHasIgnoredPrefix(name) {
+			continue
+		}
+		seen[name] = true
+	}
+
+	if len(seen) == 0 {
+		return &ImpHashResult{}, nil
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	joined := strings.Join(names, ",")
+	imports := make([]ImportEntry, 0, len(names))
+	for _, name := range names {
+		imports = append(imports, ImportEntry{Symbol: name})
+	}
+
+	result := &ImpHashResult{
+		ImpHash:   fmt.Sprintf("%x", md5.Sum([]byte(joined))),
+		ImpString: joined,
+		Imports:   imports,
+	}
+	result.ImpFuzzy, _ = ssdeep.FuzzyBytes([]byte(joined))
+
+	return result, nil
+}
+
+func telfhashHasIgnoredPrefix(name string) bool {
+	for _, prefix := range telfhashIgnoredPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package imphash
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTelfHashFromFileNormalizesRealELF(t *testing.T) {
+	const path = "/bin/ls"
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("no %s on this system: %v", path, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+
+	result, err := TelfHashFromReaderAt(f, info.Size())
+	if err != nil {
+		t.Fatalf("TelfHashFromReaderAt: %v", err)
+	}
+	if result.ImpString == "" {
+		t.Fatalf("expected a non-empty telfhash ImpString for %s", path)
+	}
+	if len(result.ImpHash) != 32 {
+		t.Fatalf("ImpHash = %q, want a 32-char MD5 hex digest", result.ImpHash)
+	}
+
+	names := strings.Split(result.ImpString, ",")
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		if name != strings.ToLower(name) {
+			t.Errorf("name %q is not lowercase", name)
+		}
+		if strings.ContainsAny(name, "@") {
+			t.Errorf("name %q still carries a symbol version suffix", name)
+		}
+		if telfhashIgnoredNames[name] || telfhashHasIgnoredPrefix(name) {
+			t.Errorf("name %q should have been filtered out", name)
+		}
+		if seen[name] {
+			t.Errorf("name %q appears more than once, expected deduped output", name)
+		}
+		seen[name] = true
+		if i > 0 && names[i-1] > name {
+			t.Fatalf("names not sorted: %q came before %q", names[i-1], name)
+		}
+	}
+
+	for i, imp := range result.Imports {
+		if imp.Symbol != names[i] || imp.Library != "" {
+			t.Errorf("Imports[%d] = %+v, want Symbol %q and empty Library", i, imp, names[i])
+		}
+	}
+}